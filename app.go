@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"html/template"
@@ -15,20 +16,17 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 
 	"github.com/SlyMarbo/rss"
-	"github.com/alexflint/bufferlinks/buffer"
 	arg "github.com/alexflint/go-arg"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/urfave/negroni"
 )
 
-const accessToken = "1/9a1c6e4de8e136b3c04c941233350e88"
-
 type visitor interface {
 	visit(n *html.Node) visitor
 }
@@ -132,8 +130,67 @@ func findLinks(s string) ([]*link, error) {
 	return v.links, nil
 }
 
-func fetch(urlstr string) ([]*article, error) {
-	feed, err := rss.Fetch(urlstr)
+// narrowBySelector returns the HTML of the first element in s matching
+// selector, which may be "#id", ".class", or a bare tag name. If nothing
+// matches, s is returned unchanged so callers can fall back to scanning
+// the whole document.
+func narrowBySelector(s, selector string) (string, error) {
+	root, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+
+	var match func(n *html.Node) bool
+	switch {
+	case strings.HasPrefix(selector, "#"):
+		id := selector[1:]
+		match = func(n *html.Node) bool { return attr(n, "id") == id }
+	case strings.HasPrefix(selector, "."):
+		class := selector[1:]
+		match = func(n *html.Node) bool {
+			for _, c := range strings.Fields(attr(n, "class")) {
+				if c == class {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		match = func(n *html.Node) bool { return n.Data == selector }
+	}
+
+	var found *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if found != nil || n == nil {
+			return
+		}
+		if n.Type == html.ElementNode && match(n) {
+			found = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	if found == nil {
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, found); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// fetch downloads fc's feed via client and returns the articles whose
+// title passes fc's include/exclude filters and which have at least
+// fc.MinLinks links (after filtering out links back to the feed's own
+// domain).
+func fetch(fc *feedConfig, client *http.Client) ([]*article, error) {
+	feed, err := rss.FetchByClient(fc.URL, client)
 	if err != nil {
 		return nil, err
 	}
@@ -145,11 +202,23 @@ func fetch(urlstr string) ([]*article, error) {
 
 	var all []*article
 	for _, item := range feed.Items {
-		if !strings.Contains(strings.ToLower(item.Title), "link") {
+		if fc.include != nil && !fc.include.MatchString(item.Title) {
+			continue
+		}
+		if fc.exclude != nil && fc.exclude.MatchString(item.Title) {
 			continue
 		}
 
-		links, err := findLinks(item.Content)
+		content := item.Content
+		if fc.Selector != "" {
+			content, err = narrowBySelector(content, fc.Selector)
+			if err != nil {
+				log.Printf("%s: %v\n", item.Title, err)
+				content = item.Content
+			}
+		}
+
+		links, err := findLinks(content)
 		if err != nil {
 			log.Printf("%s: %v\n", item.Title, err)
 		}
@@ -164,15 +233,17 @@ func fetch(urlstr string) ([]*article, error) {
 			filtered = append(filtered, link)
 		}
 
-		if len(links) > 0 {
-			all = append(all, &article{
-				Title: item.Title,
-				URL:   item.Link,
-				Links: filtered,
-				Feed:  feed.Title,
-				Date:  item.Date,
-			})
+		if len(filtered) < fc.MinLinks {
+			continue
 		}
+
+		all = append(all, &article{
+			Title: item.Title,
+			URL:   item.Link,
+			Links: filtered,
+			Feed:  fc.Name,
+			Date:  item.Date,
+		})
 	}
 	return all, nil
 }
@@ -200,36 +271,135 @@ func mustParseTemplate(path string, filesystem bool) *template.Template {
 }
 
 type app struct {
-	store        *linkStore
-	lastFetch    []*article
-	bufferClient *buffer.Client
-	debug        bool
-	profiles     []string // IDs of buffer profiles to post to
-	indexTpl     *template.Template
-	enqueueTpl   *template.Template
+	store      *linkStore
+	config     *config
+	scheduler  *scheduler
+	publishers map[string]Publisher // keyed by publisher name, chosen via enqueue form
+	httpClient *http.Client         // disk-cached client shared by the RSS fetcher and scraper
+	debug      bool
+	indexTpl   *template.Template
+	enqueueTpl *template.Template
+
+	fetchMu   sync.Mutex
+	lastFetch []*article
+
+	// configMu guards config.Feeds, which grows at runtime when OPML
+	// imports merge new feeds in alongside the reads of it by
+	// refreshFeeds (on each /admin/refresh) and scheduler.run.
+	configMu sync.Mutex
 }
 
+// fetchWorkers bounds how many feeds refreshFeeds polls concurrently.
+const fetchWorkers = 4
+
 func (a *app) loadTemplates() {
 	log.Println("loading templates...")
 	a.indexTpl = mustParseTemplate("templates/index.html", a.debug)
 	a.enqueueTpl = mustParseTemplate("templates/enqueue.html", a.debug)
 }
 
+// refreshFeeds polls every configured feed concurrently, using a small
+// worker pool, and aggregates the results into a.lastFetch. Errors from
+// individual feeds are logged rather than failing the whole refresh, so
+// one broken feed doesn't take down the others.
 func (a *app) refreshFeeds() error {
-	urlstr := "http://feeds.feedburner.com/marginalrevolution?fmt=xml"
-	articles, err := fetch(urlstr)
-	if err != nil {
-		return err
+	a.configMu.Lock()
+	feeds := a.config.Feeds
+	a.configMu.Unlock()
+
+	jobs := make(chan *feedConfig)
+	results := make(chan []*article, len(feeds))
+
+	var wg sync.WaitGroup
+	for i := 0; i < fetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fc := range jobs {
+				articles, err := fetch(fc, a.httpClient)
+				if err != nil {
+					log.Printf("%s: %v", fc.Name, err)
+					continue
+				}
+				log.Printf("parsed %d articles from %s", len(articles), fc.Name)
+				results <- articles
+			}
+		}()
+	}
+
+	go func() {
+		for _, fc := range feeds {
+			jobs <- fc
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []*article
+	for articles := range results {
+		a.indexArticles(articles)
+		all = append(all, articles...)
 	}
-	log.Printf("parsed %d articles from %s", len(articles), urlstr)
 
-	a.lastFetch = articles
+	a.fetchMu.Lock()
+	a.lastFetch = all
+	a.fetchMu.Unlock()
 	return nil
 }
 
+// addFeedConfig appends fc to the running config's feed list. Callers
+// that also want fc polled on a cadence should go through
+// a.scheduler.addFeed instead, which calls this and starts the poller.
+func (a *app) addFeedConfig(fc *feedConfig) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	a.config.Feeds = append(a.config.Feeds, fc)
+}
+
+// indexArticles adds articles and their links to the search index.
+func (a *app) indexArticles(articles []*article) {
+	for _, art := range articles {
+		if err := a.store.indexArticle(art); err != nil {
+			log.Printf("error indexing %s: %v", art.URL, err)
+		}
+		for _, l := range art.Links {
+			if err := a.store.indexLink(art, l); err != nil {
+				log.Printf("error indexing %s: %v", l.URL, err)
+			}
+		}
+	}
+}
+
+// mergeFetch replaces feedName's articles within a.lastFetch with
+// articles, leaving other feeds' articles untouched, and indexes the new
+// ones. It's how the scheduler incorporates a single feed's poll result
+// without clobbering the others'.
+func (a *app) mergeFetch(feedName string, articles []*article) {
+	a.indexArticles(articles)
+
+	a.fetchMu.Lock()
+	defer a.fetchMu.Unlock()
+
+	var kept []*article
+	for _, existing := range a.lastFetch {
+		if existing.Feed != feedName {
+			kept = append(kept, existing)
+		}
+	}
+	a.lastFetch = append(kept, articles...)
+}
+
 func (a *app) articles() ([]*article, error) {
+	a.fetchMu.Lock()
+	lastFetch := a.lastFetch
+	a.fetchMu.Unlock()
+
 	var filtered []*article
-	for _, article := range a.lastFetch {
+	for _, article := range lastFetch {
 		state, err := a.store.findArticle(article.URL)
 		if err != nil && err != sql.ErrNoRows {
 			return nil, fmt.Errorf("error while looking up article from %s in DB: %v", article.URL, err)
@@ -284,6 +454,12 @@ func (a *app) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 }
 
+// handleCommit publishes a draft to every publisher named in the
+// "publish_to" form field, which templates/enqueue.html must render as
+// one checkbox per name in .Publishers, e.g.
+// `<input type="checkbox" name="publish_to" value="{{.}}">`. With none
+// checked, r.Form["publish_to"] is empty and the commit is rejected
+// below rather than silently publishing nowhere.
 func (a *app) handleCommit(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -291,31 +467,45 @@ func (a *app) handleCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content := r.FormValue("content")
-	url := r.FormValue("url")
-	linkTitle := r.FormValue("link_title")
-	linkDescr := r.FormValue("link_descr")
+	draft := PostDraft{
+		Content:   r.FormValue("content"),
+		LinkURL:   r.FormValue("url"),
+		LinkTitle: r.FormValue("link_title"),
+		LinkDescr: r.FormValue("link_descr"),
+	}
 
-	_, err = a.bufferClient.CreateUpdate(a.profiles, buffer.UpdateOptions{
-		Content:         content,
-		LinkURL:         url,
-		LinkTitle:       linkTitle,
-		LinkDescription: linkDescr,
-	})
-	if err != nil {
-		httpError(w, err)
+	destinations := r.Form["publish_to"]
+	if len(destinations) == 0 {
+		httpError(w, "no publishers selected")
 		return
 	}
 
-	err = a.store.markLinkQueued(url)
-	if err != nil {
+	var published []string
+	for _, name := range destinations {
+		pub, ok := a.publishers[name]
+		if !ok {
+			httpError(w, "unknown publisher %q", name)
+			return
+		}
+		if _, err := pub.Publish(r.Context(), draft); err != nil {
+			httpError(w, "%s: %v", name, err)
+			return
+		}
+		published = append(published, name)
+	}
+
+	if err := a.store.markLinkQueued(draft.LinkURL, published); err != nil {
 		httpError(w, err)
 		return
 	}
 
-	fmt.Fprintln(w, "pushed post to buffer")
+	fmt.Fprintf(w, "pushed post to %s\n", strings.Join(published, ", "))
 }
 
+// handleEnqueue renders the enqueue form for linkurl, passing the sorted
+// publisher names as .Publishers so templates/enqueue.html can render
+// the checkboxes handleCommit's "publish_to" contract expects (see
+// handleCommit).
 func (a *app) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 	if a.debug {
 		a.loadTemplates()
@@ -328,8 +518,25 @@ func (a *app) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := a.enqueueTpl.Execute(w, map[string]interface{}{
-		"URL": linkurl,
+	var publisherNames []string
+	for name := range a.publishers {
+		publisherNames = append(publisherNames, name)
+	}
+	sort.Strings(publisherNames)
+
+	preview, err := a.getLinkPreview(linkurl)
+	if err != nil {
+		log.Printf("error scraping preview for %s: %v", linkurl, err)
+		preview = &linkPreview{URL: linkurl}
+	}
+
+	err = a.enqueueTpl.Execute(w, map[string]interface{}{
+		"URL":          linkurl,
+		"Title":        preview.Title,
+		"Description":  preview.Description,
+		"CanonicalURL": preview.CanonicalURL,
+		"ImageURL":     preview.ImageURL,
+		"Publishers":   publisherNames,
 	})
 	if err != nil {
 		httpError(w, err.Error())
@@ -338,12 +545,41 @@ func (a *app) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	var args struct {
-		Debug bool
-		DB    string
+		Debug        bool
+		DB           string
+		Config       string
+		CacheDir     string
+		RebuildIndex *rebuildIndexCmd `arg:"subcommand:rebuild-index"`
 	}
 	args.DB = "bufferlinks.sqlite"
+	args.Config = "bufferlinks.yaml"
+	args.CacheDir = "cache"
 	arg.MustParse(&args)
 
+	if v := os.Getenv("BUFFERLINKS_DB"); v != "" {
+		args.DB = v
+	}
+	if v := os.Getenv("BUFFERLINKS_CONFIG"); v != "" {
+		args.Config = v
+	}
+
+	if args.RebuildIndex != nil {
+		dbpath := args.RebuildIndex.DB
+		if dbpath == "" {
+			dbpath = args.DB
+		}
+		if err := rebuildSearchIndex(dbpath); err != nil {
+			log.Fatal("error rebuilding search index:", err)
+		}
+		log.Println("rebuilt search index for", dbpath)
+		return
+	}
+
+	cfg, err := loadConfig(args.Config)
+	if err != nil {
+		log.Fatal("error loading config:", err)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = ":19870"
@@ -355,45 +591,33 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Connect to Buffer
-	client := buffer.NewClient(accessToken)
-	profiles, err := client.Profiles()
+	httpClient := newCachingHTTPClient(args.CacheDir)
+
+	publishers, err := buildPublishers(cfg, httpClient)
 	if err != nil {
-		log.Fatal("error getting profiles:", err)
+		log.Fatal("error configuring publishers:", err)
+	}
+	for name := range publishers {
+		log.Printf("using publisher %s...", name)
 	}
-	var profileIDs []string
-	for _, p := range profiles {
-		if p.Service == "facebook" {
-			profileIDs = append(profileIDs, p.Id)
-			log.Printf("using %s...", p.Service)
+
+	for _, fc := range cfg.Feeds {
+		if err := store.saveFeed(fc); err != nil {
+			log.Fatal("error persisting feed:", err)
 		}
 	}
 
 	app := app{
-		store:        store,
-		bufferClient: client,
-		profiles:     profileIDs,
-		debug:        args.Debug,
+		store:      store,
+		config:     cfg,
+		publishers: publishers,
+		httpClient: httpClient,
+		debug:      args.Debug,
 	}
 	app.loadTemplates()
-
-	go func() {
-		err := app.refreshFeeds()
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Printf("fetched %d articles", len(app.lastFetch))
-	}()
-
-	// TODO: use bindata
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-	http.HandleFunc("/enqueue", app.handleEnqueue)
-	http.HandleFunc("/commit", app.handleCommit)
-	http.HandleFunc("/", app.handleIndex)
-
-	middleware := negroni.Classic()
-	middleware.UseHandler(http.DefaultServeMux)
+	app.scheduler = newScheduler(&app)
+	go app.scheduler.run(context.Background())
 
 	log.Println("listening on", port)
-	http.ListenAndServe(port, middleware)
+	http.ListenAndServe(port, app.router())
 }
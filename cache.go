@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gregjones/httpcache"
+	"github.com/gregjones/httpcache/diskcache"
+)
+
+// newCachingHTTPClient returns an *http.Client backed by a disk cache
+// rooted at cacheDir, honoring standard HTTP caching headers (ETag,
+// Last-Modified, Cache-Control). It's shared by the RSS fetcher, the
+// link-preview scraper, and the Buffer and webhook publishers, so none
+// of them hammer upstream servers on every poll or enqueue. The Mastodon
+// publisher uses its own client and the Medium publisher its SDK's.
+//
+// Timeout is set so a hung upstream actually aborts the request: the
+// underlying RSS/publisher libraries don't thread a context.Context
+// through to their HTTP calls, so a per-request deadline set here is
+// what makes deadline.go's withDeadline wrapper meaningful instead of
+// blocking forever on a wedged connection.
+func newCachingHTTPClient(cacheDir string) *http.Client {
+	transport := httpcache.NewTransport(diskcache.New(cacheDir))
+	client := transport.Client()
+	client.Timeout = fetchTimeout
+	return client
+}
+
+// headerCapture wraps a RoundTripper to record the most recent
+// response's headers, so a caller that only has access to a library
+// function built around an *http.Client (e.g. rss.FetchByClient) can
+// still inspect things like Retry-After without issuing a second
+// request of its own. Not safe for concurrent reuse across requests;
+// callers should build one per call.
+type headerCapture struct {
+	http.RoundTripper
+	header http.Header
+}
+
+func (h *headerCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := h.RoundTripper.RoundTrip(req)
+	if resp != nil {
+		h.header = resp.Header
+	}
+	return resp, err
+}
+
+// clientWithHeaderCapture returns a client that reuses base's transport
+// and timeout but records the last response's headers into the returned
+// *headerCapture.
+func clientWithHeaderCapture(base *http.Client) (*http.Client, *headerCapture) {
+	capture := &headerCapture{RoundTripper: base.Transport}
+	if capture.RoundTripper == nil {
+		capture.RoundTripper = http.DefaultTransport
+	}
+	return &http.Client{
+		Transport: capture,
+		Timeout:   base.Timeout,
+	}, capture
+}
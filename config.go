@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// feedConfig describes a single RSS/Atom feed to poll: where to fetch it,
+// which items to keep, and which region of each item's HTML to scan for
+// links.
+type feedConfig struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`
+	Include  string `yaml:"include"` // regex; item title must match to be kept
+	Exclude  string `yaml:"exclude"` // regex; item title matching this is dropped
+	MinLinks int    `yaml:"min_links"`
+	Selector string `yaml:"selector"` // narrows the HTML region findLinks scans, e.g. "#content" or ".post-body"
+	Interval string `yaml:"interval"` // Go duration string, e.g. "15m"; defaults to defaultFeedInterval
+
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	interval time.Duration
+}
+
+// publisherConfig describes one destination a link can be published to.
+// Only the fields relevant to Type need be set; the rest are ignored.
+type publisherConfig struct {
+	Type string `yaml:"type"` // "buffer", "mastodon", "medium", or "webhook"
+	Name string `yaml:"name"` // defaults to Type if unset
+
+	// buffer, medium
+	AccessToken string `yaml:"access_token"`
+
+	// buffer
+	Profiles []string `yaml:"profiles"`
+
+	// mastodon
+	ActorURL   string `yaml:"actor_url"`
+	InboxURL   string `yaml:"inbox_url"`
+	KeyID      string `yaml:"key_id"`
+	PrivateKey string `yaml:"private_key"`
+
+	// webhook
+	URL string `yaml:"url"`
+}
+
+type config struct {
+	Feeds      []*feedConfig      `yaml:"feeds"`
+	Publishers []*publisherConfig `yaml:"publishers"`
+}
+
+// loadConfig reads the YAML feed configuration at path and compiles each
+// feed's include/exclude filters.
+func loadConfig(path string) (*config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg config
+	if err := yaml.Unmarshal(buf, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+
+	for _, f := range cfg.Feeds {
+		if err := f.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+// compile validates f and compiles its include/exclude regexes.
+func (f *feedConfig) compile() error {
+	if f.URL == "" {
+		return fmt.Errorf("feed %q is missing a url", f.Name)
+	}
+	if f.MinLinks == 0 {
+		f.MinLinks = 1
+	}
+
+	var err error
+	if f.Include != "" {
+		if f.include, err = regexp.Compile(f.Include); err != nil {
+			return fmt.Errorf("feed %q has invalid include regex: %v", f.Name, err)
+		}
+	}
+	if f.Exclude != "" {
+		if f.exclude, err = regexp.Compile(f.Exclude); err != nil {
+			return fmt.Errorf("feed %q has invalid exclude regex: %v", f.Name, err)
+		}
+	}
+
+	if f.Interval != "" {
+		if f.interval, err = time.ParseDuration(f.Interval); err != nil {
+			return fmt.Errorf("feed %q has invalid interval: %v", f.Name, err)
+		}
+	} else {
+		f.interval = defaultFeedInterval
+	}
+	return nil
+}
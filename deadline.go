@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// deadlineTimer is a cancellable deadline: it fires on C after d elapses,
+// and Stop releases its underlying timer early if the caller finished
+// before that.
+type deadlineTimer struct {
+	C     <-chan time.Time
+	timer *time.Timer
+}
+
+func newDeadlineTimer(d time.Duration) *deadlineTimer {
+	t := time.NewTimer(d)
+	return &deadlineTimer{C: t.C, timer: t}
+}
+
+func (d *deadlineTimer) Stop() {
+	d.timer.Stop()
+}
+
+// withDeadline runs fn with a context that's canceled once timeout
+// elapses, racing fn's completion against a deadlineTimer. If the
+// deadline wins, withDeadline cancels ctx and waits for fn to return
+// before reporting the timeout, so fn never outlives the call.
+func withDeadline(timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dt := newDeadlineTimer(timeout)
+	defer dt.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-dt.C:
+		cancel()
+		<-done
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
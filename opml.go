@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type opmlOutline struct {
+	Text    string        `xml:"text,attr"`
+	Title   string        `xml:"title,attr"`
+	XMLURL  string        `xml:"xmlUrl,attr"`
+	Outline []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	Body struct {
+		Outline []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// parseOPML extracts feed configs from an OPML document, recursing into
+// nested outlines (the "folders" most feed readers export) so imports
+// from e.g. Feedly or NetNewsWire come through flattened.
+func parseOPML(r io.Reader) ([]*feedConfig, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var feeds []*feedConfig
+	var walk func([]opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			if o.XMLURL != "" {
+				name := o.Title
+				if name == "" {
+					name = o.Text
+				}
+				feeds = append(feeds, &feedConfig{Name: name, URL: o.XMLURL})
+			}
+			walk(o.Outline)
+		}
+	}
+	walk(doc.Body.Outline)
+	return feeds, nil
+}
+
+// handleImportOPML accepts an uploaded OPML file, merges any feeds it
+// names into the running config, records them in the feeds table via
+// linkStore, and starts a poller for each so they're picked up on a
+// cadence immediately. The feeds table is not read back at startup, so
+// imported feeds are not polled again after a restart.
+func (a *app) handleImportOPML(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("opml")
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer file.Close()
+
+	feeds, err := parseOPML(file)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	for _, f := range feeds {
+		if err := f.compile(); err != nil {
+			httpError(w, err)
+			return
+		}
+		if err := a.store.saveFeed(f); err != nil {
+			httpError(w, err)
+			return
+		}
+		a.scheduler.addFeed(f)
+	}
+
+	fmt.Fprintf(w, "imported %d feeds\n", len(feeds))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// PostDraft is the content a Publisher pushes out to its destination.
+type PostDraft struct {
+	Content   string
+	LinkURL   string
+	LinkTitle string
+	LinkDescr string
+}
+
+// PostRef identifies a post once a Publisher has delivered it.
+type PostRef struct {
+	Destination string // publisher name, e.g. "buffer", "mastodon"
+	ID          string
+}
+
+// Publisher pushes a PostDraft out to some destination, such as Buffer,
+// a Mastodon inbox, Medium, or a generic webhook.
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, draft PostDraft) (PostRef, error)
+}
+
+// buildPublishers constructs a Publisher for each entry in cfg.Publishers,
+// keyed by name so handlers can look one up by the name a user picked in
+// the enqueue form. client is the shared, timeout-bounded HTTP client
+// (cache.go) that publishers doing their own raw HTTP should use instead
+// of http.DefaultClient, so a slow destination can't hang indefinitely.
+func buildPublishers(cfg *config, client *http.Client) (map[string]Publisher, error) {
+	publishers := make(map[string]Publisher, len(cfg.Publishers))
+	for _, pc := range cfg.Publishers {
+		if pc.Name == "" {
+			pc.Name = pc.Type
+		}
+		if _, exists := publishers[pc.Name]; exists {
+			return nil, fmt.Errorf("duplicate publisher name %q", pc.Name)
+		}
+
+		var pub Publisher
+		var err error
+		switch pc.Type {
+		case "buffer":
+			pub = newBufferPublisher(pc.Name, pc.AccessToken, pc.Profiles, client)
+		case "mastodon":
+			pub, err = newMastodonPublisher(pc.Name, pc.ActorURL, pc.InboxURL, pc.KeyID, pc.PrivateKey)
+		case "medium":
+			pub, err = newMediumPublisher(pc.Name, pc.AccessToken)
+		case "webhook":
+			pub = newWebhookPublisher(pc.Name, pc.URL, client)
+		default:
+			return nil, fmt.Errorf("publisher %q has unknown type %q", pc.Name, pc.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("publisher %q: %v", pc.Name, err)
+		}
+
+		publishers[pc.Name] = pub
+	}
+	return publishers, nil
+}
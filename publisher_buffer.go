@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alexflint/bufferlinks/buffer"
+)
+
+// bufferPublisher pushes posts to one or more Buffer profiles.
+type bufferPublisher struct {
+	name     string
+	client   *buffer.Client
+	profiles []string
+}
+
+func newBufferPublisher(name, accessToken string, profiles []string, httpClient *http.Client) *bufferPublisher {
+	client := buffer.NewClient(accessToken)
+	client.HTTPClient = httpClient
+	return &bufferPublisher{
+		name:     name,
+		client:   client,
+		profiles: profiles,
+	}
+}
+
+func (p *bufferPublisher) Name() string { return p.name }
+
+func (p *bufferPublisher) Publish(ctx context.Context, draft PostDraft) (PostRef, error) {
+	_, err := p.client.CreateUpdate(p.profiles, buffer.UpdateOptions{
+		Content:         draft.Content,
+		LinkURL:         draft.LinkURL,
+		LinkTitle:       draft.LinkTitle,
+		LinkDescription: draft.LinkDescr,
+	})
+	if err != nil {
+		return PostRef{}, err
+	}
+	return PostRef{Destination: p.name, ID: draft.LinkURL}, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+// mastodonPublisher delivers posts as ActivityPub Create(Note) activities,
+// signed with HTTP Signatures the way Mastodon and other ActivityPub
+// servers require of federated actors delivering to an inbox.
+type mastodonPublisher struct {
+	name       string
+	actorURL   string // e.g. https://example.social/users/bufferlinks
+	inboxURL   string // the target instance's shared inbox
+	keyID      string // actorURL + "#main-key"
+	privateKey crypto.PrivateKey
+	client     *http.Client
+}
+
+func newMastodonPublisher(name, actorURL, inboxURL, keyID, privateKeyPEM string) (*mastodonPublisher, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("mastodon: invalid private key PEM")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("mastodon: %v", err)
+	}
+
+	return &mastodonPublisher{
+		name:       name,
+		actorURL:   actorURL,
+		inboxURL:   inboxURL,
+		keyID:      keyID,
+		privateKey: key,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *mastodonPublisher) Name() string { return p.name }
+
+func (p *mastodonPublisher) Publish(ctx context.Context, draft PostDraft) (PostRef, error) {
+	activity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Create",
+		"actor":    p.actorURL,
+		"object": map[string]interface{}{
+			"type":         "Note",
+			"attributedTo": p.actorURL,
+			"content":      fmt.Sprintf("%s %s", draft.Content, draft.LinkURL),
+		},
+	}
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return PostRef{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.inboxURL, bytes.NewReader(body))
+	if err != nil {
+		return PostRef{}, err
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+
+	signer, _, err := httpsig.NewSigner(
+		[]httpsig.Algorithm{httpsig.RSA_SHA256},
+		httpsig.DigestSha256,
+		[]string{httpsig.RequestTarget, "host", "date", "digest"},
+		httpsig.Signature,
+		0,
+	)
+	if err != nil {
+		return PostRef{}, err
+	}
+	if err := signer.SignRequest(p.privateKey, p.keyID, req, body); err != nil {
+		return PostRef{}, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return PostRef{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return PostRef{}, fmt.Errorf("mastodon: inbox returned %s", resp.Status)
+	}
+
+	return PostRef{Destination: p.name, ID: draft.LinkURL}, nil
+}
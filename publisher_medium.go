@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	medium "github.com/Medium/medium-sdk-go"
+)
+
+// mediumPublisher posts drafts to Medium as draft posts under the
+// authenticated user's account.
+type mediumPublisher struct {
+	name   string
+	client *medium.Medium
+	userID string
+}
+
+func newMediumPublisher(name, accessToken string) (*mediumPublisher, error) {
+	client := medium.NewClient("", "")
+	client.SetAccessToken(accessToken)
+
+	user, err := client.GetUser()
+	if err != nil {
+		return nil, fmt.Errorf("medium: %v", err)
+	}
+
+	return &mediumPublisher{name: name, client: client, userID: user.ID}, nil
+}
+
+func (p *mediumPublisher) Name() string { return p.name }
+
+func (p *mediumPublisher) Publish(ctx context.Context, draft PostDraft) (PostRef, error) {
+	post, err := p.client.CreatePost(medium.CreatePostOptions{
+		UserID:        p.userID,
+		Title:         draft.LinkTitle,
+		Content:       fmt.Sprintf("<p>%s</p><p><a href=%q>%s</a></p>", draft.Content, draft.LinkURL, draft.LinkDescr),
+		ContentFormat: medium.ContentFormatHTML,
+		PublishStatus: medium.PublishStatusDraft,
+	})
+	if err != nil {
+		return PostRef{}, err
+	}
+	return PostRef{Destination: p.name, ID: post.ID}, nil
+}
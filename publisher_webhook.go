@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// webhookPublisher POSTs the draft as JSON to an arbitrary URL, for
+// destinations that don't warrant their own integration.
+type webhookPublisher struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func newWebhookPublisher(name, url string, client *http.Client) *webhookPublisher {
+	return &webhookPublisher{name: name, url: url, client: client}
+}
+
+func (p *webhookPublisher) Name() string { return p.name }
+
+func (p *webhookPublisher) Publish(ctx context.Context, draft PostDraft) (PostRef, error) {
+	body, err := json.Marshal(draft)
+	if err != nil {
+		return PostRef{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return PostRef{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return PostRef{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return PostRef{}, fmt.Errorf("webhook %s: returned %s", p.name, resp.Status)
+	}
+
+	return PostRef{Destination: p.name, ID: draft.LinkURL}, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// router builds the app's route tree: a few top-level UI routes, plus
+// /api, /admin, and /static subrouters. Each subrouter is a natural slot
+// for feature-specific middleware (auth, rate limiting, ...) without
+// touching the handlers themselves.
+func (a *app) router() http.Handler {
+	r := chi.NewRouter()
+	r.Use(chimiddleware.Logger)
+	r.Use(chimiddleware.Recoverer)
+
+	r.Get("/", a.handleIndex)
+	r.Get("/enqueue", a.handleEnqueue)
+
+	r.Route("/api", func(api chi.Router) {
+		api.Post("/commit", a.handleCommit)
+		api.Get("/search", a.handleSearch)
+		api.Post("/import-opml", a.handleImportOPML)
+	})
+
+	r.Route("/admin", func(admin chi.Router) {
+		admin.Get("/status", a.handleAdminStatus)
+		admin.Get("/refresh", a.handleRefresh)
+	})
+
+	r.Route("/static", func(static chi.Router) {
+		static.Handle("/*", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	})
+
+	return r
+}
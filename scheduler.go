@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultFeedInterval applies to any feed that doesn't set its own
+// interval.
+const defaultFeedInterval = 15 * time.Minute
+
+// fetchTimeout bounds how long a single feed poll may take before it's
+// abandoned.
+const fetchTimeout = 30 * time.Second
+
+// feedStatus is a single feed's scheduling and health state, reported by
+// /admin/status.
+type feedStatus struct {
+	LastFetch  time.Time
+	NextFetch  time.Time
+	ErrorCount int
+	LastError  string
+}
+
+// scheduler polls every configured feed on its own cadence. Conditional
+// revalidation (ETag/Last-Modified) happens transparently inside
+// s.app.httpClient (cache.go), which is an httpcache-backed client, so
+// fetchOnce only ever issues a single request per tick; any Retry-After
+// the server sent on that same request clamps the next tick's wait.
+type scheduler struct {
+	app *app
+
+	mu       sync.Mutex
+	statuses map[string]*feedStatus
+
+	// ctx is the context run started its pollers with, kept around so
+	// addFeed can launch a matching poller for a feed added later (e.g.
+	// via OPML import) instead of waiting for a process restart.
+	ctx context.Context
+}
+
+func newScheduler(a *app) *scheduler {
+	return &scheduler{
+		app:      a,
+		statuses: make(map[string]*feedStatus),
+	}
+}
+
+// run starts one polling goroutine per configured feed and blocks until
+// ctx is canceled and they have returned; with no feeds configured it
+// returns at once.
+func (s *scheduler) run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	s.app.configMu.Lock()
+	feeds := s.app.config.Feeds
+	s.app.configMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, fc := range feeds {
+		wg.Add(1)
+		go func(fc *feedConfig) {
+			defer wg.Done()
+			s.pollFeed(ctx, fc)
+		}(fc)
+	}
+	wg.Wait()
+}
+
+// addFeed merges fc into the running config and launches a poller for it
+// immediately, so feeds merged in after startup (e.g. via OPML import)
+// are scheduled without waiting for a restart.
+func (s *scheduler) addFeed(fc *feedConfig) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	s.app.addFeedConfig(fc)
+	go s.pollFeed(ctx, fc)
+}
+
+func (s *scheduler) pollFeed(ctx context.Context, fc *feedConfig) {
+	for {
+		retryAfter, err := s.fetchOnce(ctx, fc)
+		s.recordResult(fc, err)
+
+		wait := fc.interval
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		s.mu.Lock()
+		s.statuses[fc.Name].NextFetch = time.Now().Add(wait)
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// fetchOnce does a single poll of fc. Revalidation against the feed's
+// previous ETag/Last-Modified happens inside s.app.httpClient itself, so
+// this issues exactly one request per tick rather than a manual
+// conditional-GET followed by a second parse request. It returns a
+// Retry-After duration if the server sent one in delta-seconds form
+// (an HTTP-date value is ignored), read off that same
+// request's response headers via a headerCapture rather than a second
+// request just to inspect them.
+func (s *scheduler) fetchOnce(ctx context.Context, fc *feedConfig) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	err := withDeadline(fetchTimeout, func(ctx context.Context) error {
+		client, capture := clientWithHeaderCapture(s.app.httpClient)
+
+		articles, err := fetch(fc, client)
+
+		if ra := capture.header.Get("Retry-After"); ra != "" {
+			if secs, convErr := strconv.Atoi(ra); convErr == nil {
+				retryAfter = time.Duration(secs) * time.Second
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+		log.Printf("parsed %d articles from %s", len(articles), fc.Name)
+		s.app.mergeFetch(fc.Name, articles)
+		return nil
+	})
+
+	return retryAfter, err
+}
+
+func (s *scheduler) recordResult(fc *feedConfig, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.statuses[fc.Name]
+	if st == nil {
+		st = &feedStatus{}
+		s.statuses[fc.Name] = st
+	}
+	st.LastFetch = time.Now()
+	if err != nil {
+		st.ErrorCount++
+		st.LastError = err.Error()
+		log.Printf("%s: %v", fc.Name, err)
+	} else {
+		st.LastError = ""
+	}
+}
+
+// snapshot returns a copy of the current per-feed status, safe to
+// render without holding the scheduler's lock.
+func (s *scheduler) snapshot() map[string]feedStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]feedStatus, len(s.statuses))
+	for name, st := range s.statuses {
+		out[name] = *st
+	}
+	return out
+}
+
+// handleAdminStatus serves /admin/status with each feed's last/next
+// fetch time and error count.
+func (a *app) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.scheduler.snapshot()); err != nil {
+		httpError(w, err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// previewTTL bounds how long a scraped linkPreview is trusted before
+// getLinkPreview re-scrapes it.
+const previewTTL = 24 * time.Hour
+
+// linkPreview holds the OpenGraph/Twitter Card/oEmbed metadata scraped
+// for a link, used to pre-populate the enqueue form.
+type linkPreview struct {
+	URL          string
+	Title        string
+	Description  string
+	CanonicalURL string
+	ImageURL     string
+	ScrapedAt    time.Time
+}
+
+// getLinkPreview returns a linkPreview for urlstr, reusing a cached one
+// from a.store if it's not older than previewTTL, and scraping it fresh
+// otherwise. A stale cached preview is preferred over a scrape failure.
+func (a *app) getLinkPreview(urlstr string) (*linkPreview, error) {
+	cached, err := a.store.findPreview(urlstr)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if cached != nil && time.Since(cached.ScrapedAt) < previewTTL {
+		return cached, nil
+	}
+
+	preview, err := scrapeLinkPreview(a.httpClient, urlstr)
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if err := a.store.savePreview(preview); err != nil {
+		log.Printf("error caching preview for %s: %v", urlstr, err)
+	}
+	return preview, nil
+}
+
+// scrapeLinkPreview fetches urlstr and extracts OpenGraph/Twitter Card
+// metadata, falling back to an oEmbed endpoint the page advertises if
+// neither OpenGraph/Twitter Card nor the page's <title> yielded a title.
+func scrapeLinkPreview(client *http.Client, urlstr string) (*linkPreview, error) {
+	resp, err := client.Get(urlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("scrape %s: got %s", urlstr, resp.Status)
+	}
+
+	root, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &linkPreview{URL: urlstr, ScrapedAt: time.Now()}
+	var oembedURL string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Meta:
+				switch {
+				case attr(n, "property") == "og:title", attr(n, "name") == "twitter:title":
+					if preview.Title == "" {
+						preview.Title = attr(n, "content")
+					}
+				case attr(n, "property") == "og:description", attr(n, "name") == "twitter:description":
+					if preview.Description == "" {
+						preview.Description = attr(n, "content")
+					}
+				case attr(n, "property") == "og:image", attr(n, "name") == "twitter:image":
+					if preview.ImageURL == "" {
+						preview.ImageURL = attr(n, "content")
+					}
+				case attr(n, "property") == "og:url":
+					if preview.CanonicalURL == "" {
+						preview.CanonicalURL = attr(n, "content")
+					}
+				}
+			case atom.Link:
+				switch {
+				case attr(n, "rel") == "canonical" && preview.CanonicalURL == "":
+					preview.CanonicalURL = attr(n, "href")
+				case attr(n, "type") == "application/json+oembed":
+					oembedURL = attr(n, "href")
+				}
+			case atom.Title:
+				if preview.Title == "" {
+					preview.Title = flatten(n)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	if preview.CanonicalURL == "" {
+		preview.CanonicalURL = urlstr
+	}
+
+	if oembedURL != "" && preview.Title == "" {
+		if err := fetchOEmbed(client, oembedURL, preview); err != nil {
+			log.Printf("oembed %s: %v", oembedURL, err)
+		}
+	}
+
+	return preview, nil
+}
+
+type oembedResponse struct {
+	Title        string `json:"title"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// fetchOEmbed fills in any of preview's Title/ImageURL left blank by
+// OpenGraph parsing, from the oEmbed endpoint the page advertised.
+func fetchOEmbed(client *http.Client, oembedURL string, preview *linkPreview) error {
+	resp, err := client.Get(oembedURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var oe oembedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&oe); err != nil {
+		return err
+	}
+	if preview.Title == "" {
+		preview.Title = oe.Title
+	}
+	if preview.ImageURL == "" {
+		preview.ImageURL = oe.ThumbnailURL
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+// Full-text search over fetched articles and links, backed by a SQLite
+// FTS5 virtual table. The go-sqlite3 driver only compiles in FTS5
+// support when built with `-tags sqlite_fts5`; without that tag the
+// CREATE VIRTUAL TABLE below fails and search is simply unavailable.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// rebuildIndexCmd is the `rebuild-index` subcommand, which (re)creates
+// the search_index table on an existing database.
+type rebuildIndexCmd struct {
+	DB string `arg:"positional" help:"path to the sqlite database to reindex"`
+}
+
+type searchResult struct {
+	Kind    string // "article" or "link"
+	Title   string
+	Feed    string
+	URL     string
+	Snippet string
+}
+
+// ensureSearchIndex creates the FTS5 virtual table backing search, if it
+// doesn't already exist. It's safe to call on every startup, including
+// against databases created before search existed.
+func (s *linkStore) ensureSearchIndex() error {
+	_, err := s.sqldb.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+			kind, title, feed, url, context, state UNINDEXED
+		)`)
+	return err
+}
+
+// indexArticle adds a to the search index if it isn't already present.
+// It's a no-op when search is disabled.
+func (s *linkStore) indexArticle(a *article) error {
+	if !s.searchEnabled {
+		return nil
+	}
+
+	var rowid int64
+	err := s.sqldb.QueryRow(`SELECT rowid FROM search_index WHERE kind='article' AND url=?`, a.URL).Scan(&rowid)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = s.sqldb.Exec(`INSERT INTO search_index(kind, title, feed, url, context, state) VALUES (?,?,?,?,?,?)`,
+		"article", a.Title, a.Feed, a.URL, "", "")
+	return err
+}
+
+// indexLink adds l, found in article a, to the search index if it isn't
+// already present. It's a no-op when search is disabled.
+func (s *linkStore) indexLink(a *article, l *link) error {
+	if !s.searchEnabled {
+		return nil
+	}
+
+	var rowid int64
+	err := s.sqldb.QueryRow(`SELECT rowid FROM search_index WHERE kind='link' AND url=?`, l.URL).Scan(&rowid)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = s.sqldb.Exec(`INSERT INTO search_index(kind, title, feed, url, context, state) VALUES (?,?,?,?,?,?)`,
+		"link", a.Title, a.Feed, l.URL, l.Context, "")
+	return err
+}
+
+// deindexArticle removes an article (but not its links) from the search
+// index, used when an article is dismissed. It's a no-op when search is
+// disabled.
+func (s *linkStore) deindexArticle(url string) error {
+	if !s.searchEnabled {
+		return nil
+	}
+	_, err := s.sqldb.Exec(`DELETE FROM search_index WHERE kind='article' AND url=?`, url)
+	return err
+}
+
+// markLinkIndexedQueued updates a link's indexed state to "queued" so
+// search results can reflect it without a full reindex. It's a no-op
+// when search is disabled.
+func (s *linkStore) markLinkIndexedQueued(url string) error {
+	if !s.searchEnabled {
+		return nil
+	}
+	_, err := s.sqldb.Exec(`UPDATE search_index SET state='queued' WHERE kind='link' AND url=?`, url)
+	return err
+}
+
+// errSearchDisabled is returned by Search when the binary wasn't built
+// with -tags sqlite_fts5, so callers can show a clear message instead of
+// a raw SQL error.
+var errSearchDisabled = errors.New("search is disabled on this build (missing -tags sqlite_fts5)")
+
+// Search runs query against the FTS5 index and returns up to limit
+// ranked results, starting at offset, each with a highlighted snippet.
+func (s *linkStore) Search(query string, limit, offset int) ([]*searchResult, error) {
+	if !s.searchEnabled {
+		return nil, errSearchDisabled
+	}
+
+	rows, err := s.sqldb.Query(`
+		SELECT kind, title, feed, url, snippet(search_index, -1, '<b>', '</b>', '...', 10)
+		FROM search_index
+		WHERE search_index MATCH ?
+		ORDER BY rank
+		LIMIT ? OFFSET ?`, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*searchResult
+	for rows.Next() {
+		r := &searchResult{}
+		if err := rows.Scan(&r.Kind, &r.Title, &r.Feed, &r.URL, &r.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// handleSearch serves /api/search?q=...&offset=..., returning ranked results
+// as JSON.
+func (a *app) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "q not provided", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	results, err := a.store.Search(q, 20, offset)
+	if err == errSearchDisabled {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		httpError(w, err)
+	}
+}
+
+// rebuildSearchIndex opens dbpath and (re)creates the search_index
+// virtual table. It's for migrating databases created before search
+// existed. Any existing index content is dropped and nothing is
+// re-indexed here: the rebuilt table starts empty and is populated by
+// later refreshes.
+func rebuildSearchIndex(dbpath string) error {
+	store, err := newLinkStore(dbpath)
+	if err != nil {
+		return err
+	}
+	_, err = store.sqldb.Exec(`DROP TABLE IF EXISTS search_index`)
+	if err != nil {
+		return err
+	}
+	return store.ensureSearchIndex()
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	gorp "gopkg.in/gorp.v1"
@@ -12,6 +13,12 @@ import (
 type linkStore struct {
 	sqldb *sql.DB
 	db    *gorp.DbMap
+
+	// searchEnabled is false when the sqlite3 driver wasn't built with
+	// -tags sqlite_fts5, in which case search_index can't be created, the
+	// index-maintenance methods become no-ops, and Search returns
+	// errSearchDisabled instead of failing the app.
+	searchEnabled bool
 }
 
 type articleState struct {
@@ -21,10 +28,31 @@ type articleState struct {
 }
 
 type linkState struct {
-	ID         int64
-	URL        string
-	ArticleURL string
-	QueuedAt   time.Time
+	ID          int64
+	URL         string
+	ArticleURL  string
+	QueuedAt    time.Time
+	PublishedTo string // comma-separated publisher names the link was queued to
+}
+
+type previewRecord struct {
+	ID           int64
+	URL          string
+	Title        string
+	Description  string
+	CanonicalURL string
+	ImageURL     string
+	ScrapedAt    time.Time
+}
+
+type feedRecord struct {
+	ID       int64
+	Name     string
+	URL      string
+	Include  string
+	Exclude  string
+	MinLinks int
+	Selector string
 }
 
 func newLinkStore(dbpath string) (*linkStore, error) {
@@ -33,6 +61,14 @@ func newLinkStore(dbpath string) (*linkStore, error) {
 		return nil, err
 	}
 
+	// go-sqlite3 only allows one writer at a time; refreshFeeds' worker
+	// pool and the scheduler's per-feed goroutines both write through
+	// this *sql.DB concurrently, and letting database/sql hand out
+	// multiple connections just means most of them get SQLITE_BUSY
+	// instead of queuing. Pin it to a single connection so writes
+	// serialize instead of erroring.
+	db.SetMaxOpenConns(1)
+
 	// construct a gorp DbMap
 	dbmap := &gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}
 	dbmap.TraceOn("[gorp]", log.New(os.Stdout, "[bufferlinks]", 0))
@@ -41,6 +77,8 @@ func newLinkStore(dbpath string) (*linkStore, error) {
 	// specifying that the Id property is an auto incrementing PK
 	dbmap.AddTableWithName(articleState{}, "articles").SetKeys(true, "ID")
 	dbmap.AddTableWithName(linkState{}, "links").SetKeys(true, "ID")
+	dbmap.AddTableWithName(feedRecord{}, "feeds").SetKeys(true, "ID")
+	dbmap.AddTableWithName(previewRecord{}, "link_previews").SetKeys(true, "ID")
 
 	// create the table. in a production system you'd generally
 	// use a migration tool, or create the tables via scripts
@@ -49,10 +87,16 @@ func newLinkStore(dbpath string) (*linkStore, error) {
 		return nil, err
 	}
 
-	return &linkStore{
+	store := &linkStore{
 		sqldb: db,
 		db:    dbmap,
-	}, nil
+	}
+	if err := store.ensureSearchIndex(); err != nil {
+		log.Printf("search disabled: %v (was the binary built with -tags sqlite_fts5?)", err)
+	} else {
+		store.searchEnabled = true
+	}
+	return store, nil
 }
 
 func (s *linkStore) findArticle(url string) (*articleState, error) {
@@ -65,10 +109,13 @@ func (s *linkStore) findArticle(url string) (*articleState, error) {
 }
 
 func (s *linkStore) markArticleDismissed(url string) error {
-	return s.db.Insert(&articleState{
+	if err := s.db.Insert(&articleState{
 		URL:         url,
 		DismissedAt: time.Now(),
-	})
+	}); err != nil {
+		return err
+	}
+	return s.deindexArticle(url)
 }
 
 func (s *linkStore) findLink(url string) (*linkState, error) {
@@ -80,10 +127,98 @@ func (s *linkStore) findLink(url string) (*linkState, error) {
 	return &link, nil
 }
 
-func (s *linkStore) markLinkQueued(url string) error {
+func (s *linkStore) markLinkQueued(url string, destinations []string) error {
 	log.Println("inserting:", url)
-	return s.db.Insert(&linkState{
-		URL:      url,
-		QueuedAt: time.Now(),
-	})
+	if err := s.db.Insert(&linkState{
+		URL:         url,
+		QueuedAt:    time.Now(),
+		PublishedTo: strings.Join(destinations, ","),
+	}); err != nil {
+		return err
+	}
+	return s.markLinkIndexedQueued(url)
+}
+
+func (s *linkStore) findFeed(url string) (*feedRecord, error) {
+	var feed feedRecord
+	err := s.db.SelectOne(&feed, `SELECT * FROM feeds WHERE url=? LIMIT 1`, url)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *linkStore) listFeeds() ([]*feedRecord, error) {
+	var feeds []*feedRecord
+	_, err := s.db.Select(&feeds, `SELECT * FROM feeds`)
+	if err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// saveFeed upserts f's metadata into the feeds table, keyed by URL.
+// Startup does not read this table back: only the config file's feeds
+// are polled after a restart.
+func (s *linkStore) saveFeed(f *feedConfig) error {
+	existing, err := s.findFeed(f.URL)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	rec := &feedRecord{
+		Name:     f.Name,
+		URL:      f.URL,
+		Include:  f.Include,
+		Exclude:  f.Exclude,
+		MinLinks: f.MinLinks,
+		Selector: f.Selector,
+	}
+	if existing != nil {
+		rec.ID = existing.ID
+		_, err := s.db.Update(rec)
+		return err
+	}
+	return s.db.Insert(rec)
+}
+
+func (s *linkStore) findPreview(url string) (*linkPreview, error) {
+	var rec previewRecord
+	err := s.db.SelectOne(&rec, `SELECT * FROM link_previews WHERE url=? LIMIT 1`, url)
+	if err != nil {
+		return nil, err
+	}
+	return &linkPreview{
+		URL:          rec.URL,
+		Title:        rec.Title,
+		Description:  rec.Description,
+		CanonicalURL: rec.CanonicalURL,
+		ImageURL:     rec.ImageURL,
+		ScrapedAt:    rec.ScrapedAt,
+	}, nil
+}
+
+// savePreview upserts p, keyed by URL, so a re-scrape replaces the
+// previous preview instead of accumulating duplicates.
+func (s *linkStore) savePreview(p *linkPreview) error {
+	var existing previewRecord
+	err := s.db.SelectOne(&existing, `SELECT * FROM link_previews WHERE url=? LIMIT 1`, p.URL)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	rec := &previewRecord{
+		URL:          p.URL,
+		Title:        p.Title,
+		Description:  p.Description,
+		CanonicalURL: p.CanonicalURL,
+		ImageURL:     p.ImageURL,
+		ScrapedAt:    p.ScrapedAt,
+	}
+	if err == nil {
+		rec.ID = existing.ID
+		_, err := s.db.Update(rec)
+		return err
+	}
+	return s.db.Insert(rec)
 }